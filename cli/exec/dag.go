@@ -0,0 +1,236 @@
+package exec
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/woodpecker-ci/woodpecker/pipeline/frontend/yaml"
+	"github.com/woodpecker-ci/woodpecker/pipeline/frontend/yaml/matrix"
+)
+
+// pipeline status values used to build the final report.
+const (
+	statusPending     = "pending"
+	statusRunning     = "running"
+	statusSuccess     = "success"
+	statusFailure     = "failure"
+	statusSkipped     = "skipped"
+	statusSkippedWhen = "skipped (when)"
+)
+
+// pipelineNode represents a single pipeline file and its place in the
+// dependency graph of a directory passed to `woodpecker exec`.
+type pipelineNode struct {
+	name      string
+	file      string
+	dependsOn []string
+	whenSkip  bool
+	status    string
+	err       error
+}
+
+// loadPipelineGraph walks dir and parses every `.yml` file far enough to
+// discover its name, `depends_on` list and whether its `when` conditions
+// match the current build, without expanding matrix axes or substituting
+// environment variables. A pipeline's name is its file's base name with
+// the `.yml` suffix stripped, which must be unique across dir since
+// `depends_on` and the graph itself key nodes by that name; two files in
+// different subdirectories sharing a base name is an error, not a silent
+// collision.
+func loadPipelineGraph(c *cli.Context, dir string) (map[string]*pipelineNode, error) {
+	metadata := metadataFromContext(c, matrix.Axis{})
+	nodes := make(map[string]*pipelineNode)
+
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, e error) error {
+		if e != nil {
+			return e
+		}
+		if !info.Mode().IsRegular() || !strings.HasSuffix(info.Name(), ".yml") {
+			return nil
+		}
+
+		dat, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		conf, err := yaml.ParseString(string(dat))
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", p, err)
+		}
+
+		name := strings.TrimSuffix(info.Name(), ".yml")
+		if existing, ok := nodes[name]; ok {
+			return fmt.Errorf("pipeline name %q is used by both %s and %s, names must be unique within %s", name, existing.file, p, dir)
+		}
+		nodes[name] = &pipelineNode{
+			name:      name,
+			file:      p,
+			dependsOn: conf.DependsOn,
+			whenSkip:  !conf.When.Match(metadata, false),
+			status:    statusPending,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// checkCycles reports an error if the dependency graph is not a DAG, or if
+// a pipeline depends on a file that does not exist in dir.
+func checkCycles(nodes map[string]*pipelineNode) error {
+	const (
+		white = 0
+		gray  = 1
+		black = 2
+	)
+	color := make(map[string]int, len(nodes))
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch color[name] {
+		case black:
+			return nil
+		case gray:
+			return fmt.Errorf("dependency cycle detected: %s", strings.Join(append(path, name), " -> "))
+		}
+
+		color[name] = gray
+		if node, ok := nodes[name]; ok {
+			for _, dep := range node.dependsOn {
+				if _, exists := nodes[dep]; !exists {
+					return fmt.Errorf("pipeline %q depends on unknown pipeline %q", name, dep)
+				}
+				if err := visit(dep, append(path, name)); err != nil {
+					return err
+				}
+			}
+		}
+		color[name] = black
+		return nil
+	}
+
+	for name := range nodes {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPipelineGraph executes every node of the graph, respecting
+// depends_on ordering, running independent branches concurrently up to
+// parallel at a time. A failing pipeline marks its dependents as skipped
+// instead of aborting unrelated branches.
+func runPipelineGraph(c *cli.Context, nodes map[string]*pipelineNode, repoPath string, parallel int) error {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		sem = make(chan struct{}, parallel)
+	)
+
+	done := make(map[string]chan struct{}, len(nodes))
+	for name := range nodes {
+		done[name] = make(chan struct{})
+	}
+
+	for name, node := range nodes {
+		wg.Add(1)
+		go func(name string, node *pipelineNode) {
+			defer wg.Done()
+			defer close(done[name])
+
+			for _, dep := range node.dependsOn {
+				<-done[dep]
+			}
+
+			mu.Lock()
+			skip := false
+			for _, dep := range node.dependsOn {
+				if depNode := nodes[dep]; depNode.status != statusSuccess && depNode.status != statusSkippedWhen {
+					skip = true
+					break
+				}
+			}
+			switch {
+			case skip:
+				node.status = statusSkipped
+			case node.whenSkip:
+				node.status = statusSkippedWhen
+			default:
+				node.status = statusRunning
+			}
+			mu.Unlock()
+
+			if skip {
+				fmt.Printf("# %s (skipped, dependency did not succeed)\n\n", node.name)
+				return
+			}
+			if node.whenSkip {
+				fmt.Printf("# %s (skipped, when conditions do not match)\n\n", node.name)
+				return
+			}
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			fmt.Println("#", filepath.Base(node.file))
+			err := runExec(c, node.file, repoPath)
+			fmt.Println("")
+
+			mu.Lock()
+			if err != nil {
+				node.status = statusFailure
+				node.err = err
+			} else {
+				node.status = statusSuccess
+			}
+			mu.Unlock()
+		}(name, node)
+	}
+
+	wg.Wait()
+
+	return reportPipelineGraph(nodes)
+}
+
+// reportPipelineGraph prints a structured summary of every pipeline that
+// was part of the graph and returns an error if any of them failed or was
+// skipped because a dependency did not succeed. Pipelines skipped because
+// their own `when` conditions did not match are reported but do not count
+// as a failure, the same way a server-side build treats a conditional skip.
+func reportPipelineGraph(nodes map[string]*pipelineNode) error {
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	failed := false
+	fmt.Println("pipeline summary:")
+	for _, name := range names {
+		node := nodes[name]
+		fmt.Printf("  %-20s %s\n", node.name, node.status)
+		if node.status == statusFailure || node.status == statusSkipped {
+			failed = true
+		}
+	}
+
+	if failed {
+		return fmt.Errorf("one or more pipelines did not complete successfully")
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package exec
+
+import "testing"
+
+func TestCheckCyclesDetectsCycle(t *testing.T) {
+	nodes := map[string]*pipelineNode{
+		"a": {name: "a", dependsOn: []string{"b"}},
+		"b": {name: "b", dependsOn: []string{"a"}},
+	}
+
+	if err := checkCycles(nodes); err == nil {
+		t.Fatal("expected a dependency cycle error, got nil")
+	}
+}
+
+func TestCheckCyclesAcceptsDAG(t *testing.T) {
+	nodes := map[string]*pipelineNode{
+		"a": {name: "a"},
+		"b": {name: "b", dependsOn: []string{"a"}},
+		"c": {name: "c", dependsOn: []string{"a", "b"}},
+	}
+
+	if err := checkCycles(nodes); err != nil {
+		t.Fatalf("checkCycles: %v", err)
+	}
+}
+
+func TestCheckCyclesRejectsUnknownDependency(t *testing.T) {
+	nodes := map[string]*pipelineNode{
+		"a": {name: "a", dependsOn: []string{"missing"}},
+	}
+
+	if err := checkCycles(nodes); err == nil {
+		t.Fatal("expected an unknown-dependency error, got nil")
+	}
+}
+
+func TestReportPipelineGraphFailsOnFailure(t *testing.T) {
+	nodes := map[string]*pipelineNode{
+		"a": {name: "a", status: statusSuccess},
+		"b": {name: "b", status: statusFailure},
+	}
+
+	if err := reportPipelineGraph(nodes); err == nil {
+		t.Fatal("expected reportPipelineGraph to return an error")
+	}
+}
+
+func TestReportPipelineGraphFailsOnDependencySkip(t *testing.T) {
+	nodes := map[string]*pipelineNode{
+		"a": {name: "a", status: statusFailure},
+		"b": {name: "b", status: statusSkipped},
+	}
+
+	if err := reportPipelineGraph(nodes); err == nil {
+		t.Fatal("expected reportPipelineGraph to return an error for a skipped dependent")
+	}
+}
+
+func TestReportPipelineGraphIgnoresWhenSkip(t *testing.T) {
+	nodes := map[string]*pipelineNode{
+		"a": {name: "a", status: statusSuccess},
+		"b": {name: "b", status: statusSkippedWhen},
+	}
+
+	if err := reportPipelineGraph(nodes); err != nil {
+		t.Fatalf("expected a when-skip to not be treated as a failure, got: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package exec
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/woodpecker-ci/woodpecker/pipeline"
+	backendTypes "github.com/woodpecker-ci/woodpecker/pipeline/backend/types"
+)
+
+// debugOptions configures the interactive breakpoints exec can drop into
+// while running a pipeline.
+type debugOptions struct {
+	stepShell      string
+	pauseOnFailure bool
+}
+
+func debugOptionsFromContext(c *cli.Context) debugOptions {
+	return debugOptions{
+		stepShell:      c.String("step-shell"),
+		pauseOnFailure: c.Bool("pause-on-failure"),
+	}
+}
+
+// withDebugHooks wraps a tracer so that, depending on opts, it drops the
+// user into an interactive shell inside a step's container before it runs
+// (--step-shell) or right after it fails (--pause-on-failure).
+func withDebugHooks(ctx context.Context, base pipeline.Tracer, engine backendTypes.Engine, opts debugOptions) pipeline.Tracer {
+	if opts.stepShell == "" && !opts.pauseOnFailure {
+		return base
+	}
+
+	return pipeline.TraceFunc(func(state *pipeline.State) error {
+		// pipeline.Run() only ever traces per-step transitions, so
+		// state.Pipeline.Step is always set here.
+		step := state.Pipeline.Step
+
+		starting := state.Process == nil || !state.Process.Exited
+		if starting && opts.stepShell == step.Alias {
+			fmt.Printf("# breakpoint before step %q, dropping into a shell\n", step.Alias)
+			if err := debugShell(ctx, engine, step); err != nil {
+				fmt.Fprintf(os.Stderr, "debug shell failed: %v\n", err)
+			}
+		}
+
+		err := base.Trace(state)
+
+		if !starting && opts.pauseOnFailure && state.Process != nil && state.Process.ExitCode != 0 {
+			fmt.Printf("# step %q failed with exit code %d, dropping into a shell\n", step.Alias, state.Process.ExitCode)
+			if shellErr := debugShell(ctx, engine, step); shellErr != nil {
+				fmt.Fprintf(os.Stderr, "debug shell failed: %v\n", shellErr)
+			}
+		}
+
+		return err
+	})
+}
+
+// debugShell attaches an interactive shell inside the step's container
+// using the backend engine's Attach API, wiring the current process's
+// stdin/stdout/stderr through.
+func debugShell(ctx context.Context, engine backendTypes.Engine, step *backendTypes.Step) error {
+	stdio := backendTypes.Stdio{
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	return engine.Attach(ctx, step, []string{"/bin/sh"}, stdio)
+}
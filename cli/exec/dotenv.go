@@ -0,0 +1,69 @@
+package exec
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/drone/envsubst"
+)
+
+// loadEnvFile parses a dotenv-style file, expanding `${VAR}` references
+// against base and any variable already defined earlier in the same file,
+// and returns a new map with base merged underneath the file's values.
+func loadEnvFile(path string, base map[string]string) (map[string]string, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(base))
+	for k, v := range base {
+		result[k] = v
+	}
+
+	for _, line := range strings.Split(string(dat), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		idx := strings.Index(line, "=")
+		if idx < 0 {
+			continue
+		}
+		key := strings.TrimSpace(line[:idx])
+		val, literal := unquoteEnvValue(strings.TrimSpace(line[idx+1:]))
+
+		expanded := val
+		if !literal {
+			var err error
+			expanded, err = envsubst.Eval(val, func(name string) string {
+				return result[name]
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		result[key] = expanded
+	}
+
+	return result, nil
+}
+
+// unquoteEnvValue strips a single matching pair of surrounding quotes from
+// a dotenv value, the same way a shell would, and reports whether it was
+// single-quoted. A single-quoted value is literal and must not be passed
+// through envsubst, the same way a shell never expands `$VAR` inside ''.
+func unquoteEnvValue(val string) (unquoted string, literal bool) {
+	if len(val) < 2 {
+		return val, false
+	}
+	if val[0] == '\'' && val[len(val)-1] == '\'' {
+		return val[1 : len(val)-1], true
+	}
+	if val[0] == '"' && val[len(val)-1] == '"' {
+		return val[1 : len(val)-1], false
+	}
+	return val, false
+}
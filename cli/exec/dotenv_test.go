@@ -0,0 +1,60 @@
+package exec
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".env")
+	contents := "export FOO=bar\nBAZ=\"quoted value\"\nQUX='single ${FOO}'\nREF=${FOO}-${BAZ}\n# comment\n\nTRAILING=ok \n"
+	if err := ioutil.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("write env file: %v", err)
+	}
+
+	env, err := loadEnvFile(path, map[string]string{"BASE": "1"})
+	if err != nil {
+		t.Fatalf("loadEnvFile: %v", err)
+	}
+
+	cases := map[string]string{
+		"BASE":     "1",
+		"FOO":      "bar",
+		"BAZ":      "quoted value",
+		"QUX":      "single ${FOO}",
+		"REF":      "bar-quoted value",
+		"TRAILING": "ok",
+	}
+	for k, want := range cases {
+		if got := env[k]; got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+}
+
+func TestLoadEnvFileLaterFileOverrides(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.env")
+	second := filepath.Join(dir, "b.env")
+	if err := ioutil.WriteFile(first, []byte("FOO=first\n"), 0o600); err != nil {
+		t.Fatalf("write first env file: %v", err)
+	}
+	if err := ioutil.WriteFile(second, []byte("FOO=second\n"), 0o600); err != nil {
+		t.Fatalf("write second env file: %v", err)
+	}
+
+	merged, err := loadEnvFile(first, nil)
+	if err != nil {
+		t.Fatalf("loadEnvFile first: %v", err)
+	}
+	merged, err = loadEnvFile(second, merged)
+	if err != nil {
+		t.Fatalf("loadEnvFile second: %v", err)
+	}
+
+	if merged["FOO"] != "second" {
+		t.Fatalf("FOO = %q, want later file to win", merged["FOO"])
+	}
+}
@@ -5,10 +5,10 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"os"
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/drone/envsubst"
@@ -17,6 +17,11 @@ import (
 	"github.com/woodpecker-ci/woodpecker/cli/common"
 	"github.com/woodpecker-ci/woodpecker/pipeline"
 	"github.com/woodpecker-ci/woodpecker/pipeline/backend"
+	// registers the bundled and kubernetes backend engines with
+	// pipeline/backend
+	_ "github.com/woodpecker-ci/woodpecker/pipeline/backend/docker"
+	_ "github.com/woodpecker-ci/woodpecker/pipeline/backend/kubernetes"
+	_ "github.com/woodpecker-ci/woodpecker/pipeline/backend/local"
 	backendTypes "github.com/woodpecker-ci/woodpecker/pipeline/backend/types"
 	"github.com/woodpecker-ci/woodpecker/pipeline/frontend"
 	"github.com/woodpecker-ci/woodpecker/pipeline/frontend/yaml"
@@ -33,34 +38,107 @@ var Command = &cli.Command{
 	Usage:     "execute a local build",
 	ArgsUsage: "[path/to/.woodpecker.yml]",
 	Action:    run,
-	Flags:     append(common.GlobalFlags, flags...),
+	Flags: append(common.GlobalFlags, append(flags,
+		&cli.IntFlag{
+			Name:  "parallel",
+			Usage: "number of pipelines from the directory to run concurrently",
+			Value: 1,
+		},
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "output format, one of: text, json, junit",
+			Value: outputText,
+		},
+		&cli.StringSliceFlag{
+			Name:  "env-file",
+			Usage: "load environment variables from a dotenv file, repeatable, later files win",
+		},
+		&cli.StringSliceFlag{
+			Name:  "secrets-file",
+			Usage: "load secrets from a YAML file of {name, value, events, images}, repeatable",
+		},
+		&cli.StringFlag{
+			Name:  "k8s-namespace",
+			Usage: "kubernetes namespace to run steps in, used with --backend-engine=kubernetes",
+			Value: "default",
+		},
+		&cli.StringFlag{
+			Name:  "k8s-kubeconfig",
+			Usage: "path to the kubeconfig used with --backend-engine=kubernetes",
+		},
+		&cli.StringFlag{
+			Name:  "k8s-pull-secret",
+			Usage: "name of the image pull secret to use with --backend-engine=kubernetes",
+		},
+		&cli.StringFlag{
+			Name:  "step-shell",
+			Usage: "drop into an interactive shell before the named step runs",
+		},
+		&cli.BoolFlag{
+			Name:  "pause-on-failure",
+			Usage: "keep a step's container alive and drop into an interactive shell when it fails",
+		},
+	)...),
+}
+
+// pipelineImages collects the distinct container images used by conf's
+// steps, so --secrets-file entries can be scoped to the images they apply
+// to, matching the server's secret model.
+func pipelineImages(conf *yaml.Config) []string {
+	seen := make(map[string]bool)
+	var images []string
+	for _, container := range conf.Pipeline.Containers {
+		if container.Image == "" || seen[container.Image] {
+			continue
+		}
+		seen[container.Image] = true
+		images = append(images, container.Image)
+	}
+	return images
+}
+
+// backendConfigurer is implemented by backend engines that need extra
+// CLI-provided configuration before Load, such as the kubernetes engine.
+type backendConfigurer interface {
+	Configure(namespace, kubeconfig, pullSecret string)
+}
+
+// pauseOnFailureConfigurer is implemented by backend engines that run
+// steps in their own isolated environment (e.g. a container or Pod) and
+// need to know up front to keep a failed step's environment alive for
+// --pause-on-failure instead of tearing it down immediately. Engines like
+// local, which has nothing to tear down between Exec and Attach, don't
+// need to implement it.
+type pauseOnFailureConfigurer interface {
+	SetPauseOnFailure(pauseOnFailure bool)
 }
 
 func run(c *cli.Context) error {
-	return common.RunPipelineFunc(c, execFile, execDir)
+	if err := common.RunPipelineFunc(c, execFile, execDir); err != nil {
+		return err
+	}
+	return finalizeOutput(c.String("output"))
 }
 
 func execDir(c *cli.Context, dir string) error {
-	// TODO: respect pipeline dependency
 	repoPath, _ := filepath.Abs(filepath.Dir(dir))
 	if runtime.GOOS == "windows" {
 		repoPath = convertPathForWindows(repoPath)
 	}
-	return filepath.Walk(dir, func(path string, info os.FileInfo, e error) error {
-		if e != nil {
-			return e
-		}
-
-		// check if it is a regular file (not dir)
-		if info.Mode().IsRegular() && strings.HasSuffix(info.Name(), ".yml") {
-			fmt.Println("#", info.Name())
-			_ = runExec(c, path, repoPath) // TODO: should we drop errors or store them and report back?
-			fmt.Println("")
-			return nil
-		}
 
+	nodes, err := loadPipelineGraph(c, dir)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
 		return nil
-	})
+	}
+
+	if err := checkCycles(nodes); err != nil {
+		return err
+	}
+
+	return runPipelineGraph(c, nodes, repoPath, c.Int("parallel"))
 }
 
 func execFile(c *cli.Context, file string) error {
@@ -107,6 +185,13 @@ func execWithAxis(c *cli.Context, file, repoPath string, axis matrix.Axis) error
 	}
 
 	droneEnv := make(map[string]string)
+	for _, envFile := range c.StringSlice("env-file") {
+		merged, err := loadEnvFile(envFile, droneEnv)
+		if err != nil {
+			return fmt.Errorf("load env-file %s: %w", envFile, err)
+		}
+		droneEnv = merged
+	}
 	for _, env := range c.StringSlice("env") {
 		envs := strings.SplitN(env, "=", 2)
 		droneEnv[envs[0]] = envs[1]
@@ -128,6 +213,15 @@ func execWithAxis(c *cli.Context, file, repoPath string, axis matrix.Axis) error
 		return err
 	}
 
+	for _, secretsFile := range c.StringSlice("secrets-file") {
+		fileSecrets, err := loadSecretsFile(secretsFile, metadata.Curr.Event, pipelineImages(conf))
+		if err != nil {
+			return fmt.Errorf("load secrets-file %s: %w", secretsFile, err)
+		}
+		secrets = append(secrets, fileSecrets...)
+	}
+	masker := newSecretMasker(secrets, droneEnv)
+
 	// configure volumes for local execution
 	volumes := c.StringSlice("volumes")
 	if c.Bool("local") {
@@ -186,6 +280,17 @@ func execWithAxis(c *cli.Context, file, repoPath string, axis matrix.Axis) error
 		return err
 	}
 
+	if configurable, ok := engine.(backendConfigurer); ok {
+		configurable.Configure(
+			c.String("k8s-namespace"),
+			c.String("k8s-kubeconfig"),
+			c.String("k8s-pull-secret"),
+		)
+	}
+	if pausable, ok := engine.(pauseOnFailureConfigurer); ok {
+		pausable.SetPauseOnFailure(c.Bool("pause-on-failure"))
+	}
+
 	if err = engine.Load(); err != nil {
 		return err
 	}
@@ -196,12 +301,59 @@ func execWithAxis(c *cli.Context, file, repoPath string, axis matrix.Axis) error
 		println("ctrl+c received, terminating process")
 	})
 
-	return pipeline.New(compiled,
+	tracer, logger, pipelineStart, pipelineEnd := tracerAndLoggerFor(c, file, axis, masker)
+	tracer = withDebugHooks(ctx, tracer, engine, debugOptionsFromContext(c))
+
+	pipelineStart()
+	runErr := pipeline.New(compiled,
 		pipeline.WithContext(ctx),
-		pipeline.WithTracer(pipeline.DefaultTracer),
-		pipeline.WithLogger(defaultLogger),
+		pipeline.WithTracer(tracer),
+		pipeline.WithLogger(logger),
 		pipeline.WithEngine(engine),
 	).Run()
+	pipelineEnd(runErr)
+	return runErr
+}
+
+// tracerAndLoggerFor selects the pipeline.Tracer and pipeline.Logger to use
+// for a pipeline run based on the --output flag, along with the
+// pipeline-level start/end hooks execWithAxis calls around pipeline.Run()
+// (a no-op pair outside --output=json).
+func tracerAndLoggerFor(c *cli.Context, file string, axis matrix.Axis, masker *secretMasker) (pipeline.Tracer, pipeline.Logger, func(), func(error)) {
+	pipelineName := strings.TrimSuffix(filepath.Base(file), ".yml")
+
+	switch c.String("output") {
+	case outputJSON:
+		start, end := jsonPipelineEvents(pipelineName, defaultJSONEmitter, masker)
+		return jsonTracer(pipelineName, defaultJSONEmitter, masker), jsonLogger(pipelineName, defaultJSONEmitter, masker), start, end
+	case outputJUnit:
+		label := axisLabel(axis)
+		start, end := noopPipelineEvents()
+		return junitTracer(pipelineName, label, defaultJUnitCollector, masker), junitLogger(defaultJUnitCollector, masker), start, end
+	default:
+		start, end := noopPipelineEvents()
+		return pipeline.DefaultTracer, newTextLogger(masker), start, end
+	}
+}
+
+// axisLabel renders a matrix axis as a stable, human-readable suffix so
+// reports can tell apart multiple axes of the same pipeline file, or ""
+// for the single implicit axis of a pipeline with no matrix.
+func axisLabel(axis matrix.Axis) string {
+	if len(axis) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(axis))
+	for k := range axis {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%s", k, axis[k]))
+	}
+	return strings.Join(parts, ",")
 }
 
 // return the metadata from the cli context.
@@ -280,13 +432,29 @@ func convertPathForWindows(path string) string {
 	return filepath.ToSlash(path)
 }
 
-var defaultLogger = pipeline.LogFunc(func(proc *backendTypes.Step, rc multipart.Reader) error {
-	part, err := rc.NextPart()
-	if err != nil {
-		return err
-	}
+// newTextLogger copies step output to stdout, redacting masker's values,
+// scoped to a single pipeline run so concurrent --parallel runs never
+// share masking state.
+func newTextLogger(masker *secretMasker) pipeline.Logger {
+	return pipeline.LogFunc(func(proc *backendTypes.Step, rc multipart.Reader) error {
+		part, err := rc.NextPart()
+		if err != nil {
+			return err
+		}
 
-	logStream := NewLineWriter(proc.Alias)
-	_, err = io.Copy(logStream, part)
-	return err
-})
+		logStream := NewLineWriter(proc.Alias)
+		maskedStream := masker.wrap(logStream)
+		_, err = io.Copy(maskedStream, part)
+		// flush any bytes maskWriter held back in case they were the
+		// start of a secret split across two reads of part. wrap()
+		// returns logStream itself, not a *maskWriter, when there is
+		// nothing to mask, so this only ever closes a maskWriter's own
+		// buffering, never logStream.
+		if mw, ok := maskedStream.(*maskWriter); ok {
+			if cerr := mw.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	})
+}
@@ -0,0 +1,136 @@
+package exec
+
+import (
+	"io"
+	"strings"
+
+	"github.com/woodpecker-ci/woodpecker/pipeline/frontend/yaml/compiler"
+)
+
+const maskedPlaceholder = "******"
+
+// secretMasker redacts a fixed set of values from step output. It is built
+// once per pipeline run from that run's own secrets and env, so concurrent
+// pipelines (--parallel) never share or race over masking state.
+type secretMasker struct {
+	values []string
+}
+
+// newSecretMasker collects every secret and loaded env value for a single
+// pipeline run.
+func newSecretMasker(secrets []compiler.Secret, env map[string]string) *secretMasker {
+	m := &secretMasker{}
+	for _, s := range secrets {
+		if s.Value != "" {
+			m.values = append(m.values, s.Value)
+		}
+	}
+	for _, v := range env {
+		if v != "" {
+			m.values = append(m.values, v)
+		}
+	}
+	return m
+}
+
+// wrap returns a writer that redacts m's values before forwarding to w. A
+// read loop using wrap should Close the returned writer once its source is
+// exhausted, to flush bytes maskWriter held back in case they were the
+// start of a secret split across two Write calls.
+func (m *secretMasker) wrap(w io.Writer) io.Writer {
+	if len(m.values) == 0 {
+		return w
+	}
+	return &maskWriter{w: w, masker: m, maxValueLen: m.maxValueLen()}
+}
+
+// mask redacts m's values from s, for output modes that handle output as
+// discrete strings (e.g. one JSON event per line) instead of a byte stream.
+func (m *secretMasker) mask(s string) string {
+	for _, v := range m.values {
+		s = strings.ReplaceAll(s, v, maskedPlaceholder)
+	}
+	return s
+}
+
+// maxValueLen returns the length of m's longest value, used by maskWriter
+// to bound how many trailing bytes of a Write it needs to hold back.
+func (m *secretMasker) maxValueLen() int {
+	max := 0
+	for _, v := range m.values {
+		if len(v) > max {
+			max = len(v)
+		}
+	}
+	return max
+}
+
+// maskWriter redacts its masker's values before forwarding bytes to the
+// wrapped writer. A secret can straddle the boundary between two Write
+// calls (e.g. a log stream copied in fixed-size chunks), so maskWriter
+// buffers the tail of each write that could still be the start of an
+// unfinished match and only forwards it once more bytes rule that out (or
+// Close is called because the stream ended). Its masker is immutable
+// after construction, and pending/buf are only ever touched from the
+// single pipeline goroutine a maskWriter belongs to, so no extra locking
+// is needed.
+type maskWriter struct {
+	w           io.Writer
+	masker      *secretMasker
+	maxValueLen int
+	pending     []byte
+}
+
+func (m *maskWriter) Write(p []byte) (int, error) {
+	buf := append(m.pending, p...)
+
+	masked := buf
+	for _, v := range m.masker.values {
+		masked = []byte(strings.ReplaceAll(string(masked), v, maskedPlaceholder))
+	}
+
+	holdback := m.holdbackLen(masked)
+	if _, err := m.w.Write(masked[:len(masked)-holdback]); err != nil {
+		m.pending = nil
+		return 0, err
+	}
+	m.pending = append([]byte{}, masked[len(masked)-holdback:]...)
+
+	return len(p), nil
+}
+
+// holdbackLen returns how many trailing bytes of buf could still be the
+// unfinished start of one of m's values, and so must not be forwarded yet.
+func (m *maskWriter) holdbackLen(buf []byte) int {
+	max := m.maxValueLen - 1
+	if max <= 0 {
+		return 0
+	}
+	if max > len(buf) {
+		max = len(buf)
+	}
+
+	for l := max; l > 0; l-- {
+		suffix := buf[len(buf)-l:]
+		for _, v := range m.masker.values {
+			if len(v) > l && strings.HasPrefix(v, string(suffix)) {
+				return l
+			}
+		}
+	}
+	return 0
+}
+
+// Close flushes any bytes Write held back because they could have been
+// the start of a secret, to be called once the writer's source is
+// exhausted and no more bytes can arrive to complete (or rule out) a
+// match.
+func (m *maskWriter) Close() error {
+	if len(m.pending) == 0 {
+		return nil
+	}
+	pending := m.pending
+	m.pending = nil
+	_, err := m.w.Write(pending)
+	return err
+}
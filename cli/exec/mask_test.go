@@ -0,0 +1,84 @@
+package exec
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/woodpecker-ci/woodpecker/pipeline/frontend/yaml/compiler"
+)
+
+func TestSecretMaskerRedactsSecretsAndEnv(t *testing.T) {
+	masker := newSecretMasker(
+		[]compiler.Secret{{Name: "token", Value: "s3cr3t"}},
+		map[string]string{"API_KEY": "hunter2"},
+	)
+
+	var buf bytes.Buffer
+	w := masker.wrap(&buf)
+
+	if _, err := w.Write([]byte("login with s3cr3t and hunter2\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	got := buf.String()
+	if bytes.Contains([]byte(got), []byte("s3cr3t")) || bytes.Contains([]byte(got), []byte("hunter2")) {
+		t.Fatalf("expected secrets to be redacted, got %q", got)
+	}
+	if got != "login with "+maskedPlaceholder+" and "+maskedPlaceholder+"\n" {
+		t.Fatalf("unexpected output: %q", got)
+	}
+}
+
+func TestSecretMaskerMaskRedactsString(t *testing.T) {
+	masker := newSecretMasker(
+		[]compiler.Secret{{Name: "token", Value: "s3cr3t"}},
+		nil,
+	)
+
+	got := masker.mask("login with s3cr3t")
+	want := "login with " + maskedPlaceholder
+	if got != want {
+		t.Fatalf("mask() = %q, want %q", got, want)
+	}
+}
+
+func TestSecretMaskerRedactsSecretSplitAcrossWrites(t *testing.T) {
+	masker := newSecretMasker(
+		[]compiler.Secret{{Name: "token", Value: "s3cr3t"}},
+		nil,
+	)
+
+	var buf bytes.Buffer
+	w := masker.wrap(&buf)
+
+	if _, err := w.Write([]byte("login with s3c")); err != nil {
+		t.Fatalf("write 1: %v", err)
+	}
+	if _, err := w.Write([]byte("r3t\n")); err != nil {
+		t.Fatalf("write 2: %v", err)
+	}
+	if closer, ok := w.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+	}
+
+	got := buf.String()
+	if bytes.Contains([]byte(got), []byte("s3cr3t")) {
+		t.Fatalf("expected secret split across writes to be redacted, got %q", got)
+	}
+	if got != "login with "+maskedPlaceholder+"\n" {
+		t.Fatalf("unexpected output: %q", got)
+	}
+}
+
+func TestSecretMaskerNoValuesIsNoop(t *testing.T) {
+	masker := newSecretMasker(nil, nil)
+
+	var buf bytes.Buffer
+	w := masker.wrap(&buf)
+	if w != io.Writer(&buf) {
+		t.Fatalf("expected wrap to return the original writer when there is nothing to mask")
+	}
+}
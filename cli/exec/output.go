@@ -0,0 +1,336 @@
+package exec
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/woodpecker-ci/woodpecker/pipeline"
+	backendTypes "github.com/woodpecker-ci/woodpecker/pipeline/backend/types"
+	"github.com/woodpecker-ci/woodpecker/pipeline/multipart"
+)
+
+// output modes supported by the --output flag.
+const (
+	outputText  = "text"
+	outputJSON  = "json"
+	outputJUnit = "junit"
+)
+
+// execEvent is a single structured lifecycle event emitted in --output=json
+// mode, one JSON object per line.
+type execEvent struct {
+	Type     string `json:"type"`
+	Pipeline string `json:"pipeline,omitempty"`
+	Step     string `json:"step,omitempty"`
+	Line     string `json:"line,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+	Duration int64  `json:"duration_ms,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// jsonEmitter writes one execEvent per line to w.
+type jsonEmitter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newJSONEmitter(w io.Writer) *jsonEmitter {
+	return &jsonEmitter{w: w}
+}
+
+// defaultJSONEmitter is shared by every pipeline run in a single `exec`
+// invocation, the same way defaultJUnitCollector is, so concurrent
+// --parallel runs serialize against one mutex instead of interleaving
+// writes to os.Stdout from independent emitters.
+var defaultJSONEmitter = newJSONEmitter(os.Stdout)
+
+func (e *jsonEmitter) emit(ev execEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_ = json.NewEncoder(e.w).Encode(ev)
+}
+
+// jsonLogger streams step output as one "log" execEvent per line, instead
+// of copying raw bytes straight to stdout, redacting masker's values the
+// same way the text logger does.
+func jsonLogger(pipelineName string, emitter *jsonEmitter, masker *secretMasker) pipeline.Logger {
+	return pipeline.LogFunc(func(proc *backendTypes.Step, rc multipart.Reader) error {
+		part, err := rc.NextPart()
+		if err != nil {
+			return err
+		}
+
+		scanner := bufio.NewScanner(part)
+		for scanner.Scan() {
+			emitter.emit(execEvent{
+				Type:     "step_log",
+				Pipeline: pipelineName,
+				Step:     proc.Alias,
+				Line:     masker.mask(scanner.Text()),
+			})
+		}
+		return scanner.Err()
+	})
+}
+
+// jsonTracer emits "step_start"/"step_end" execEvents for lifecycle
+// transitions reported by the pipeline.Tracer, tagging every event with
+// pipelineName so a consumer can tell concurrently run pipelines
+// (--parallel) apart on the shared defaultJSONEmitter. pipeline.Tracer is
+// only ever invoked per-step, so pipeline-level "pipeline_start"/
+// "pipeline_end" events are emitted separately by jsonPipelineEvents,
+// wrapped directly around the pipeline.Run() call.
+func jsonTracer(pipelineName string, emitter *jsonEmitter, masker *secretMasker) pipeline.Tracer {
+	started := make(map[string]time.Time)
+	var mu sync.Mutex
+
+	return pipeline.TraceFunc(func(state *pipeline.State) error {
+		step := state.Pipeline.Step
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if state.Process == nil || !state.Process.Exited {
+			started[step.Alias] = time.Now()
+			emitter.emit(execEvent{
+				Type:     "step_start",
+				Pipeline: pipelineName,
+				Step:     step.Alias,
+			})
+			return nil
+		}
+
+		duration := int64(0)
+		if start, ok := started[step.Alias]; ok {
+			duration = time.Since(start).Milliseconds()
+		}
+
+		ev := execEvent{
+			Type:     "step_end",
+			Pipeline: pipelineName,
+			Step:     step.Alias,
+			ExitCode: state.Process.ExitCode,
+			Duration: duration,
+		}
+		if state.Pipeline.Error != nil {
+			ev.Error = masker.mask(state.Pipeline.Error.Error())
+		}
+		emitter.emit(ev)
+		return nil
+	})
+}
+
+// jsonPipelineEvents returns the start/end hooks execWithAxis calls
+// directly around its pipeline.New(...).Run() call to emit
+// "pipeline_start"/"pipeline_end" execEvents. These can't be driven off
+// pipeline.Tracer like step_start/step_end are: pipeline.Run() only ever
+// traces per-step transitions, so there is no step-less trace call a
+// tracer could hook for pipeline-level lifecycle events.
+func jsonPipelineEvents(pipelineName string, emitter *jsonEmitter, masker *secretMasker) (start func(), end func(error)) {
+	var startedAt time.Time
+
+	start = func() {
+		startedAt = time.Now()
+		emitter.emit(execEvent{
+			Type:     "pipeline_start",
+			Pipeline: pipelineName,
+		})
+	}
+
+	end = func(runErr error) {
+		ev := execEvent{
+			Type:     "pipeline_end",
+			Pipeline: pipelineName,
+			Duration: time.Since(startedAt).Milliseconds(),
+		}
+		if runErr != nil {
+			ev.Error = masker.mask(runErr.Error())
+		}
+		emitter.emit(ev)
+	}
+	return start, end
+}
+
+// noopPipelineEvents are the start/end hooks used for output modes other
+// than json, which have no pipeline-level lifecycle event to emit.
+func noopPipelineEvents() (start func(), end func(error)) {
+	return func() {}, func(error) {}
+}
+
+// junitCase is a single recorded step outcome, kept around until the whole
+// `exec` invocation finishes so a report covering every pipeline, step and
+// matrix axis can be rendered in one go. Axis distinguishes the testcases
+// of a pipeline run multiple times under different matrix axes, and is
+// empty for a pipeline with no matrix.
+type junitCase struct {
+	Pipeline string
+	Step     string
+	Axis     string
+	ExitCode int
+	Duration time.Duration
+	Error    string
+}
+
+// junitCollector accumulates junitCases across every pipeline and matrix
+// axis run during a single `exec` invocation.
+type junitCollector struct {
+	mu    sync.Mutex
+	cases []junitCase
+}
+
+var defaultJUnitCollector = &junitCollector{}
+
+func (j *junitCollector) add(c junitCase) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.cases = append(j.cases, c)
+}
+
+// junitLogger drains step output instead of forwarding it, matching the
+// non-interactive nature of a generated report. It still routes the
+// stream through masker, the same way the text and JSON loggers do, so a
+// future reader of this function can't reintroduce a leak by wiring its
+// drained bytes somewhere observable without remembering to mask them.
+func junitLogger(collector *junitCollector, masker *secretMasker) pipeline.Logger {
+	return pipeline.LogFunc(func(proc *backendTypes.Step, rc multipart.Reader) error {
+		part, err := rc.NextPart()
+		if err != nil {
+			return err
+		}
+		// drain the log stream, it is not included in the report.
+		_, err = io.Copy(masker.wrap(io.Discard), part)
+		return err
+	})
+}
+
+// junitTracer records step outcomes for pipelineName's run under the
+// matrix axis identified by axisLabel, so multiple axes of the same
+// pipeline file produce distinct, identifiable testcases in the report.
+func junitTracer(pipelineName, axisLabel string, collector *junitCollector, masker *secretMasker) pipeline.Tracer {
+	started := make(map[string]time.Time)
+	var mu sync.Mutex
+
+	return pipeline.TraceFunc(func(state *pipeline.State) error {
+		step := state.Pipeline.Step
+		if step == nil {
+			return nil
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if state.Process == nil || !state.Process.Exited {
+			started[step.Alias] = time.Now()
+			return nil
+		}
+
+		duration := time.Duration(0)
+		if start, ok := started[step.Alias]; ok {
+			duration = time.Since(start)
+		}
+
+		c := junitCase{
+			Pipeline: pipelineName,
+			Step:     step.Alias,
+			Axis:     axisLabel,
+			ExitCode: state.Process.ExitCode,
+			Duration: duration,
+		}
+		if state.Pipeline.Error != nil {
+			c.Error = masker.mask(state.Pipeline.Error.Error())
+		}
+		collector.add(c)
+		return nil
+	})
+}
+
+// JUnit XML document types, following the conventional surefire-style
+// schema most CI report consumers expect.
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name    string        `xml:"name,attr"`
+	Time    float64       `xml:"time,attr"`
+	Failure *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnitReport renders every recorded junitCase, grouped by pipeline,
+// as a JUnit XML document.
+func writeJUnitReport(w io.Writer, collector *junitCollector) error {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	suites := make(map[string]*junitTestSuite)
+	var order []string
+	for _, c := range collector.cases {
+		suite, ok := suites[c.Pipeline]
+		if !ok {
+			suite = &junitTestSuite{Name: c.Pipeline}
+			suites[c.Pipeline] = suite
+			order = append(order, c.Pipeline)
+		}
+
+		name := c.Step
+		if c.Axis != "" {
+			name = fmt.Sprintf("%s (%s)", c.Step, c.Axis)
+		}
+		tc := junitTestCase{
+			Name: name,
+			Time: c.Duration.Seconds(),
+		}
+		if c.ExitCode != 0 || c.Error != "" {
+			suite.Failures++
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("exit code %d", c.ExitCode),
+				Text:    c.Error,
+			}
+		}
+		suite.Tests++
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	doc := junitTestSuites{}
+	for _, name := range order {
+		doc.Suites = append(doc.Suites, *suites[name])
+	}
+
+	fmt.Fprint(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// finalizeOutput is invoked once after every pipeline has run, to flush a
+// JUnit report if --output=junit was requested. JSON and text modes stream
+// their output as they go and need no finalization step.
+func finalizeOutput(outputMode string) error {
+	if outputMode != outputJUnit {
+		return nil
+	}
+	return writeJUnitReport(os.Stdout, defaultJUnitCollector)
+}
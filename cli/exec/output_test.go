@@ -0,0 +1,97 @@
+package exec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteJUnitReportGroupsByPipelineAndFlagsFailures(t *testing.T) {
+	collector := &junitCollector{}
+	collector.add(junitCase{Pipeline: "build", Step: "compile", ExitCode: 0, Duration: time.Second})
+	collector.add(junitCase{Pipeline: "build", Step: "test", ExitCode: 1, Duration: 2 * time.Second, Error: "boom"})
+	collector.add(junitCase{Pipeline: "lint", Step: "vet", ExitCode: 0, Duration: 500 * time.Millisecond})
+
+	var buf bytes.Buffer
+	if err := writeJUnitReport(&buf, collector); err != nil {
+		t.Fatalf("writeJUnitReport: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		`<testsuite name="build" tests="2" failures="1">`,
+		`<testsuite name="lint" tests="1" failures="0">`,
+		`name="compile"`,
+		`name="test"`,
+		`<failure message="exit code 1">boom</failure>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected report to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteJUnitReportDistinguishesMatrixAxes(t *testing.T) {
+	collector := &junitCollector{}
+	collector.add(junitCase{Pipeline: "build", Step: "test", Axis: "go=1.20", ExitCode: 0, Duration: time.Second})
+	collector.add(junitCase{Pipeline: "build", Step: "test", Axis: "go=1.21", ExitCode: 1, Duration: time.Second})
+
+	var buf bytes.Buffer
+	if err := writeJUnitReport(&buf, collector); err != nil {
+		t.Fatalf("writeJUnitReport: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		`<testsuite name="build" tests="2" failures="1">`,
+		`name="test (go=1.20)"`,
+		`name="test (go=1.21)"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected report to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestJSONPipelineEventsEmitsStartAndEnd(t *testing.T) {
+	var buf bytes.Buffer
+	emitter := newJSONEmitter(&buf)
+	masker := newSecretMasker(nil, nil)
+
+	start, end := jsonPipelineEvents("build", emitter, masker)
+	start()
+	end(errors.New("boom"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 events, got %d: %q", len(lines), buf.String())
+	}
+
+	var startEv, endEv execEvent
+	if err := json.Unmarshal([]byte(lines[0]), &startEv); err != nil {
+		t.Fatalf("unmarshal start event: %v", err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &endEv); err != nil {
+		t.Fatalf("unmarshal end event: %v", err)
+	}
+
+	if startEv.Type != "pipeline_start" || startEv.Pipeline != "build" {
+		t.Errorf("unexpected start event: %+v", startEv)
+	}
+	if endEv.Type != "pipeline_end" || endEv.Pipeline != "build" || endEv.Error != "boom" {
+		t.Errorf("unexpected end event: %+v", endEv)
+	}
+}
+
+func TestWriteJUnitReportEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeJUnitReport(&buf, &junitCollector{}); err != nil {
+		t.Fatalf("writeJUnitReport: %v", err)
+	}
+	if !strings.Contains(buf.String(), "<testsuites></testsuites>") {
+		t.Errorf("expected empty testsuites document, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,67 @@
+package exec
+
+import (
+	"io/ioutil"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/woodpecker-ci/woodpecker/pipeline/frontend/yaml/compiler"
+)
+
+// secretFileEntry mirrors the fields of the server's secret model that are
+// relevant to a local run: the value itself, and the event/image filters
+// used to decide whether it applies to the pipeline being executed.
+type secretFileEntry struct {
+	Name   string   `yaml:"name"`
+	Value  string   `yaml:"value"`
+	Events []string `yaml:"events"`
+	Images []string `yaml:"images"`
+}
+
+// loadSecretsFile parses a YAML list of secrets and returns the ones that
+// apply to the given build event and pipeline images, as compiler.Secret
+// values ready to be passed to compiler.WithSecret.
+func loadSecretsFile(path, event string, images []string) ([]compiler.Secret, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []secretFileEntry
+	if err := yaml.Unmarshal(dat, &entries); err != nil {
+		return nil, err
+	}
+
+	secrets := make([]compiler.Secret, 0, len(entries))
+	for _, entry := range entries {
+		if len(entry.Events) > 0 && !stringSliceContains(entry.Events, event) {
+			continue
+		}
+		if len(entry.Images) > 0 && !stringSlicesIntersect(entry.Images, images) {
+			continue
+		}
+		secrets = append(secrets, compiler.Secret{
+			Name:  entry.Name,
+			Value: entry.Value,
+		})
+	}
+	return secrets, nil
+}
+
+func stringSliceContains(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+func stringSlicesIntersect(a, b []string) bool {
+	for _, v := range a {
+		if stringSliceContains(b, v) {
+			return true
+		}
+	}
+	return false
+}
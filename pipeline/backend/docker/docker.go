@@ -0,0 +1,426 @@
+// Package docker implements the default pipeline/backend Engine, running
+// each step as its own Docker container against the local Docker daemon.
+package docker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+
+	"github.com/woodpecker-ci/woodpecker/pipeline/backend"
+	backendTypes "github.com/woodpecker-ci/woodpecker/pipeline/backend/types"
+	"github.com/woodpecker-ci/woodpecker/pipeline/multipart"
+)
+
+func init() {
+	backend.Register(New())
+}
+
+// Engine runs pipeline steps as containers on a local Docker daemon.
+type Engine struct {
+	mu             sync.Mutex
+	pauseOnFailure bool
+
+	client client.APIClient
+
+	// runSeq and runIDs give every pipeline run (one Setup/Destroy pair) a
+	// unique id, so directories of pipelines with same-named steps don't
+	// collide on container names, including under --parallel.
+	runSeq uint64
+	runIDs map[*backendTypes.Step]string
+}
+
+// New returns an unconfigured docker Engine. Call Load before using it.
+func New() *Engine {
+	return &Engine{}
+}
+
+// Name implements types.Engine.
+func (e *Engine) Name() string {
+	return "docker"
+}
+
+// SetPauseOnFailure implements the exec command's pauseOnFailureConfigurer
+// hook: when set, a failed step's container is kept alive instead of
+// exiting, so --pause-on-failure has something to Attach into.
+func (e *Engine) SetPauseOnFailure(pauseOnFailure bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pauseOnFailure = pauseOnFailure
+}
+
+// Load implements types.Engine by connecting to the Docker daemon
+// referenced by the standard DOCKER_HOST/DOCKER_* environment variables.
+// execWithAxis calls Load once per pipeline run, which --parallel can now
+// do from several goroutines against the same process-wide engine
+// instance, so e.mu guards the write of e.client the same way
+// SetPauseOnFailure and Exec already guard their fields.
+func (e *Engine) Load() error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return fmt.Errorf("create docker client: %w", err)
+	}
+
+	e.mu.Lock()
+	e.client = cli
+	e.mu.Unlock()
+	return nil
+}
+
+// Setup implements types.Engine by creating the networks and volumes
+// conf's steps share. Containers are still created lazily per step in
+// Exec, but every step of conf is assigned the same run id here so their
+// container names stay unique across concurrently running pipelines.
+func (e *Engine) Setup(ctx context.Context, conf *backendTypes.Config) error {
+	e.mu.Lock()
+	e.runSeq++
+	runID := fmt.Sprintf("%d", e.runSeq)
+
+	if e.runIDs == nil {
+		e.runIDs = make(map[*backendTypes.Step]string)
+	}
+	for _, step := range conf.Steps {
+		e.runIDs[step] = runID
+	}
+	e.mu.Unlock()
+
+	for _, vol := range conf.Volumes {
+		if _, err := e.client.VolumeCreate(ctx, volume.CreateOptions{Name: vol.Name}); err != nil {
+			return fmt.Errorf("create volume %s: %w", vol.Name, err)
+		}
+	}
+	for _, net := range conf.Networks {
+		if _, err := e.client.NetworkCreate(ctx, net.Name, types.NetworkCreate{Driver: net.Driver}); err != nil {
+			return fmt.Errorf("create network %s: %w", net.Name, err)
+		}
+	}
+	return nil
+}
+
+// Exec implements types.Engine by creating and running the step's
+// container to completion. With --pause-on-failure, the step's real
+// entrypoint/command is wrapped so a failure doesn't stop the container
+// (see pauseOnFailureScript), and Exec reports completion by watching the
+// container's logs for the wrapper's exit marker instead of waiting for
+// the container to stop, so the caller's --pause-on-failure breakpoint can
+// Attach to the container while it is still alive and paused.
+func (e *Engine) Exec(ctx context.Context, step *backendTypes.Step) error {
+	name := e.containerName(step)
+
+	if err := e.pull(ctx, step.Image); err != nil {
+		return err
+	}
+
+	env := make([]string, 0, len(step.Environment))
+	for k, v := range step.Environment {
+		env = append(env, k+"="+v)
+	}
+
+	e.mu.Lock()
+	pauseOnFailure := e.pauseOnFailure
+	e.mu.Unlock()
+
+	entrypoint := step.Entrypoint
+	cmd := step.Command
+	if pauseOnFailure {
+		entrypoint = []string{"/bin/sh", "-c", pauseOnFailureScript}
+		cmd = append([]string{"woodpecker-step"}, append(append([]string{}, step.Entrypoint...), step.Command...)...)
+	}
+
+	created, err := e.client.ContainerCreate(ctx, &container.Config{
+		Image:      step.Image,
+		Entrypoint: entrypoint,
+		Cmd:        cmd,
+		Env:        env,
+		// Tty keeps the container's combined stdout/stderr as a single
+		// plain stream instead of Docker's multiplexed stdcopy framing,
+		// which Tail and waitForStepExit both assume.
+		Tty: true,
+	}, nil, nil, nil, name)
+	if err != nil {
+		return fmt.Errorf("create container %s: %w", name, err)
+	}
+
+	if err := e.client.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		return fmt.Errorf("start container %s: %w", name, err)
+	}
+
+	if pauseOnFailure {
+		return e.waitForStepExit(ctx, name)
+	}
+
+	statusCh, errCh := e.client.ContainerWait(ctx, created.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("wait for container %s: %w", name, err)
+		}
+	case status := <-statusCh:
+		if status.StatusCode != 0 {
+			return fmt.Errorf("container %s exited with code %d", name, status.StatusCode)
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// pauseOnFailureMarker prefixes the line pauseOnFailureScript prints once
+// the step's real command has exited, letting waitForStepExit learn the
+// exit code from the container's logs without waiting for the container
+// itself to stop.
+const pauseOnFailureMarker = "##woodpecker-step-exit-code##"
+
+// pauseOnFailureScript runs "$@" (the step's real entrypoint/command,
+// passed as positional args by Exec) to completion, reports its exit code
+// via pauseOnFailureMarker, and on failure sleeps for an hour instead of
+// exiting, so the container stays around long enough for
+// --pause-on-failure to attach an interactive shell to it.
+const pauseOnFailureScript = `"$@"
+code=$?
+echo "` + pauseOnFailureMarker + `$code"
+if [ "$code" -ne 0 ]; then
+	sleep 3600
+fi
+exit "$code"
+`
+
+// waitForStepExit streams the named container's logs looking for the line
+// pauseOnFailureScript prints once the step's real command exits, and
+// returns as soon as it sees one, without waiting for the container to
+// stop itself (it won't, until the pause sleep elapses).
+func (e *Engine) waitForStepExit(ctx context.Context, name string) error {
+	stream, err := e.client.ContainerLogs(ctx, name, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Follow: true})
+	if err != nil {
+		return fmt.Errorf("stream logs for container %s: %w", name, err)
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		line := scanner.Text()
+		idx := strings.Index(line, pauseOnFailureMarker)
+		if idx < 0 {
+			continue
+		}
+
+		code, err := strconv.Atoi(strings.TrimSpace(line[idx+len(pauseOnFailureMarker):]))
+		if err != nil {
+			return fmt.Errorf("parse exit code reported by container %s: %w", name, err)
+		}
+		if code != 0 {
+			return fmt.Errorf("container %s failed with exit code %d", name, code)
+		}
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read logs for container %s: %w", name, err)
+	}
+	return fmt.Errorf("container %s exited before reporting its status", name)
+}
+
+// Attach implements types.Engine by exec-ing cmd inside the step's running
+// container, used by --step-shell and --pause-on-failure to drop a user
+// into a debug shell. A --step-shell breakpoint fires before the step's
+// own container has been created by Exec, so Attach creates a
+// short-lived idle container to attach to in that case and tears it down
+// again once the session ends, leaving Exec free to create the real
+// container the step actually runs in.
+func (e *Engine) Attach(ctx context.Context, step *backendTypes.Step, cmd []string, stdio backendTypes.Stdio) error {
+	name := e.containerName(step)
+
+	_, err := e.client.ContainerInspect(ctx, name)
+	switch {
+	case client.IsErrNotFound(err):
+		debugName, createErr := e.createDebugContainer(ctx, step)
+		if createErr != nil {
+			return createErr
+		}
+		defer e.deleteDebugContainer(ctx, debugName)
+		name = debugName
+	case err != nil:
+		return fmt.Errorf("inspect container %s: %w", name, err)
+	}
+
+	return e.execInContainer(ctx, name, cmd, stdio)
+}
+
+// execInContainer runs cmd inside the named container over the exec API,
+// streaming stdio.
+func (e *Engine) execInContainer(ctx context.Context, name string, cmd []string, stdio backendTypes.Stdio) error {
+	created, err := e.client.ContainerExecCreate(ctx, name, types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdin:  stdio.Stdin != nil,
+		AttachStdout: stdio.Stdout != nil,
+		AttachStderr: stdio.Stderr != nil,
+		Tty:          true,
+	})
+	if err != nil {
+		return fmt.Errorf("create exec for container %s: %w", name, err)
+	}
+
+	resp, err := e.client.ContainerExecAttach(ctx, created.ID, types.ExecStartCheck{Tty: true})
+	if err != nil {
+		return fmt.Errorf("attach exec for container %s: %w", name, err)
+	}
+	defer resp.Close()
+
+	if stdio.Stdin != nil {
+		go func() {
+			_, _ = io.Copy(resp.Conn, stdio.Stdin)
+		}()
+	}
+	if stdio.Stdout != nil {
+		_, err = io.Copy(stdio.Stdout, resp.Reader)
+	}
+	return err
+}
+
+// createDebugContainer starts a short-lived container with an idle
+// command, reusing step's image and environment, for Attach to drop a
+// shell into before the step's real container exists yet.
+func (e *Engine) createDebugContainer(ctx context.Context, step *backendTypes.Step) (string, error) {
+	name := e.debugContainerName(step)
+
+	env := make([]string, 0, len(step.Environment))
+	for k, v := range step.Environment {
+		env = append(env, k+"="+v)
+	}
+
+	if err := e.pull(ctx, step.Image); err != nil {
+		return "", err
+	}
+
+	created, err := e.client.ContainerCreate(ctx, &container.Config{
+		Image:      step.Image,
+		Entrypoint: []string{"/bin/sh"},
+		Cmd:        []string{"-c", "sleep 3600"},
+		Env:        env,
+		Tty:        true,
+	}, nil, nil, nil, name)
+	if err != nil {
+		return "", fmt.Errorf("create debug container %s: %w", name, err)
+	}
+
+	if err := e.client.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		return "", fmt.Errorf("start debug container %s: %w", name, err)
+	}
+	return name, nil
+}
+
+// deleteDebugContainer removes a container created by createDebugContainer.
+// Deletion errors are not fatal to the debug session that already ran.
+func (e *Engine) deleteDebugContainer(ctx context.Context, name string) {
+	if err := e.client.ContainerRemove(ctx, name, types.ContainerRemoveOptions{Force: true}); err != nil && !client.IsErrNotFound(err) {
+		fmt.Printf("# warning: failed to clean up debug container %s: %v\n", name, err)
+	}
+}
+
+// Tail implements types.Engine by streaming the container's combined
+// stdout/stderr log output through a multipart.Reader that yields a
+// single part, matching how a container only ever produces one log
+// stream.
+func (e *Engine) Tail(ctx context.Context, step *backendTypes.Step) (multipart.Reader, error) {
+	name := e.containerName(step)
+
+	rc, err := e.client.ContainerLogs(ctx, name, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("stream logs for container %s: %w", name, err)
+	}
+	return newSinglePartReader(rc), nil
+}
+
+// Destroy implements types.Engine by removing every container this engine
+// created for the pipeline, along with its networks.
+func (e *Engine) Destroy(ctx context.Context, conf *backendTypes.Config) error {
+	defer func() {
+		e.mu.Lock()
+		for _, step := range conf.Steps {
+			delete(e.runIDs, step)
+		}
+		e.mu.Unlock()
+	}()
+
+	for _, step := range conf.Steps {
+		name := e.containerName(step)
+		if err := e.client.ContainerRemove(ctx, name, types.ContainerRemoveOptions{Force: true}); err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("remove container %s: %w", name, err)
+		}
+	}
+	for _, net := range conf.Networks {
+		if err := e.client.NetworkRemove(ctx, net.Name); err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("remove network %s: %w", net.Name, err)
+		}
+	}
+	return nil
+}
+
+// pull fetches image if it isn't already present locally.
+func (e *Engine) pull(ctx context.Context, image string) error {
+	_, _, err := e.client.ImageInspectWithRaw(ctx, image)
+	if err == nil {
+		return nil
+	}
+
+	out, err := e.client.ImagePull(ctx, image, types.ImagePullOptions{})
+	if err != nil {
+		return fmt.Errorf("pull image %s: %w", image, err)
+	}
+	defer out.Close()
+	_, err = io.Copy(io.Discard, out)
+	return err
+}
+
+// containerName derives a container name for step that is unique across
+// concurrently running pipelines by combining the run id assigned in
+// Setup with the step name, and easy to recognize (and clean up) among
+// unrelated containers on the host.
+func (e *Engine) containerName(step *backendTypes.Step) string {
+	e.mu.Lock()
+	runID := e.runIDs[step]
+	e.mu.Unlock()
+
+	if runID == "" {
+		runID = "norun"
+	}
+	return fmt.Sprintf("woodpecker-%s-%s", runID, step.Name)
+}
+
+// debugContainerName names the short-lived container createDebugContainer
+// starts for a --step-shell breakpoint that fires before the step's own
+// container exists.
+func (e *Engine) debugContainerName(step *backendTypes.Step) string {
+	return e.containerName(step) + "-debug"
+}
+
+// singlePartReader adapts a plain stream into a multipart.Reader that
+// yields exactly one part.
+type singlePartReader struct {
+	r    io.ReadCloser
+	done bool
+}
+
+func newSinglePartReader(r io.ReadCloser) *singlePartReader {
+	return &singlePartReader{r: r}
+}
+
+func (s *singlePartReader) NextPart() (io.Reader, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	s.done = true
+	return s.r, nil
+}
@@ -0,0 +1,460 @@
+// Package kubernetes implements a pipeline/backend Engine that runs each
+// step as its own Pod, useful for dry-running pipelines against a real
+// cluster instead of a local Docker daemon.
+package kubernetes
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
+
+	"github.com/woodpecker-ci/woodpecker/pipeline/backend"
+	"github.com/woodpecker-ci/woodpecker/pipeline/backend/types"
+	"github.com/woodpecker-ci/woodpecker/pipeline/multipart"
+)
+
+func init() {
+	backend.Register(New())
+}
+
+// Engine runs pipeline steps as Kubernetes Pods.
+type Engine struct {
+	mu sync.Mutex
+
+	namespace      string
+	kubeconfig     string
+	pullSecret     string
+	pauseOnFailure bool
+
+	client     kubernetes.Interface
+	restConfig *rest.Config
+
+	// runSeq and runIDs give every pipeline run (one Setup/Destroy pair) a
+	// unique id, so directories of pipelines with same-named steps don't
+	// collide on Pod names, including under --parallel.
+	runSeq uint64
+	runIDs map[*types.Step]string
+}
+
+// New returns an unconfigured kubernetes Engine. Call Configure before
+// Load to point it at a namespace, kubeconfig and pull secret.
+func New() *Engine {
+	return &Engine{namespace: "default"}
+}
+
+// Configure sets the namespace, kubeconfig path and image pull secret the
+// engine uses, mirroring the exec command's --k8s-* flags.
+func (e *Engine) Configure(namespace, kubeconfig, pullSecret string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if namespace != "" {
+		e.namespace = namespace
+	}
+	e.kubeconfig = kubeconfig
+	e.pullSecret = pullSecret
+}
+
+// SetPauseOnFailure implements the exec command's pauseOnFailureConfigurer
+// hook, so --pause-on-failure works the same way regardless of which
+// backend engine is selected.
+func (e *Engine) SetPauseOnFailure(pauseOnFailure bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pauseOnFailure = pauseOnFailure
+}
+
+// Name implements types.Engine.
+func (e *Engine) Name() string {
+	return "kubernetes"
+}
+
+// Load implements types.Engine. execWithAxis calls Load once per pipeline
+// run, which --parallel can now do from several goroutines against the
+// same process-wide engine instance, so e.mu guards both the read of
+// e.kubeconfig and the write of e.client/e.restConfig the same way
+// Configure and Setup already guard their fields.
+func (e *Engine) Load() error {
+	e.mu.Lock()
+	kubeconfig := e.kubeconfig
+	e.mu.Unlock()
+
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return fmt.Errorf("build kubeconfig: %w", err)
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("create kubernetes client: %w", err)
+	}
+
+	e.mu.Lock()
+	e.client = client
+	e.restConfig = config
+	e.mu.Unlock()
+	return nil
+}
+
+// Setup implements types.Engine. Kubernetes Pods are still created lazily
+// per step in Exec, but every step of conf is assigned the same run id
+// here so their Pod names stay unique across concurrently running
+// pipelines.
+func (e *Engine) Setup(_ context.Context, conf *types.Config) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.runSeq++
+	runID := fmt.Sprintf("%d", e.runSeq)
+
+	if e.runIDs == nil {
+		e.runIDs = make(map[*types.Step]string)
+	}
+	for _, step := range conf.Steps {
+		e.runIDs[step] = runID
+	}
+	return nil
+}
+
+// Exec implements types.Engine by creating a Pod for the step and waiting
+// for it to finish. With --pause-on-failure, the step's container is
+// wrapped so a failure doesn't terminate it (see podForStep), and Exec
+// reports completion by watching the step's logs for the wrapper's exit
+// marker instead of waiting for the Pod to reach a terminal phase, so the
+// caller's --pause-on-failure breakpoint can Attach to the Pod while it is
+// still alive and paused.
+func (e *Engine) Exec(ctx context.Context, step *types.Step) error {
+	pod := e.podForStep(step)
+
+	if _, err := e.client.CoreV1().Pods(e.namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("create pod %s: %w", pod.Name, err)
+	}
+
+	if e.pauseOnFailure {
+		return e.waitForStepExit(ctx, pod.Name)
+	}
+	return e.waitForPod(ctx, pod.Name)
+}
+
+// Attach implements types.Engine by attaching an interactive command to
+// the step's Pod via the exec subresource, used to drop a user into a
+// shell for --step-shell and --pause-on-failure. A --step-shell breakpoint
+// fires before the step's own Pod has been created by Exec, so Attach
+// creates a short-lived idle Pod to attach to in that case and tears it
+// down again once the session ends, leaving Exec free to create the real
+// Pod the step actually runs in.
+func (e *Engine) Attach(ctx context.Context, step *types.Step, cmd []string, stdio types.Stdio) error {
+	podName := e.podName(step)
+
+	_, err := e.client.CoreV1().Pods(e.namespace).Get(ctx, podName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		debugPod, createErr := e.createDebugPod(ctx, step)
+		if createErr != nil {
+			return createErr
+		}
+		defer e.deleteDebugPod(ctx, debugPod.Name)
+		podName = debugPod.Name
+	case err != nil:
+		return fmt.Errorf("get pod %s: %w", podName, err)
+	}
+
+	return e.attachToPod(ctx, podName, cmd, stdio)
+}
+
+// attachToPod streams cmd into the named Pod over the exec subresource.
+func (e *Engine) attachToPod(ctx context.Context, podName string, cmd []string, stdio types.Stdio) error {
+	req := e.client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(e.namespace).
+		Name(podName).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: "step",
+			Command:   cmd,
+			Stdin:     stdio.Stdin != nil,
+			Stdout:    stdio.Stdout != nil,
+			Stderr:    stdio.Stderr != nil,
+			TTY:       true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(e.restConfig, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("create exec stream for pod %s: %w", podName, err)
+	}
+
+	return executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  stdio.Stdin,
+		Stdout: stdio.Stdout,
+		Stderr: stdio.Stderr,
+		Tty:    true,
+	})
+}
+
+// createDebugPod starts a short-lived Pod with an idle command, reusing
+// step's image and environment, for Attach to drop a shell into before the
+// step's real Pod exists yet.
+func (e *Engine) createDebugPod(ctx context.Context, step *types.Step) (*corev1.Pod, error) {
+	pod := e.podForStep(step)
+	pod.Name = e.debugPodName(step)
+	pod.Spec.Containers[0].Command = []string{"/bin/sh"}
+	pod.Spec.Containers[0].Args = []string{"-c", "sleep 3600"}
+
+	created, err := e.client.CoreV1().Pods(e.namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("create debug pod %s: %w", pod.Name, err)
+	}
+
+	if err := e.waitForPodRunning(ctx, created.Name); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// deleteDebugPod removes a Pod created by createDebugPod. Deletion errors
+// are not fatal to the debug session that already ran.
+func (e *Engine) deleteDebugPod(ctx context.Context, name string) {
+	if err := e.client.CoreV1().Pods(e.namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		fmt.Printf("# warning: failed to clean up debug pod %s: %v\n", name, err)
+	}
+}
+
+// Tail implements types.Engine by streaming the Pod's combined log output
+// through a multipart.Reader that yields a single part, matching how a Pod
+// only ever produces one log stream.
+func (e *Engine) Tail(ctx context.Context, step *types.Step) (multipart.Reader, error) {
+	req := e.client.CoreV1().Pods(e.namespace).GetLogs(e.podName(step), &corev1.PodLogOptions{
+		Follow: true,
+	})
+
+	stream, err := req.Stream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("stream logs for pod %s: %w", e.podName(step), err)
+	}
+
+	return newSinglePartReader(stream), nil
+}
+
+// Destroy implements types.Engine by deleting every Pod this engine
+// created for the pipeline.
+func (e *Engine) Destroy(ctx context.Context, conf *types.Config) error {
+	defer func() {
+		e.mu.Lock()
+		for _, step := range conf.Steps {
+			delete(e.runIDs, step)
+		}
+		e.mu.Unlock()
+	}()
+
+	for _, step := range conf.Steps {
+		name := e.podName(step)
+		err := e.client.CoreV1().Pods(e.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("delete pod %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (e *Engine) podForStep(step *types.Step) *corev1.Pod {
+	env := make([]corev1.EnvVar, 0, len(step.Environment))
+	for k, v := range step.Environment {
+		env = append(env, corev1.EnvVar{Name: k, Value: v})
+	}
+
+	var pullSecrets []corev1.LocalObjectReference
+	if e.pullSecret != "" {
+		pullSecrets = append(pullSecrets, corev1.LocalObjectReference{Name: e.pullSecret})
+	}
+
+	command := step.Entrypoint
+	args := step.Command
+	if e.pauseOnFailure {
+		// Run the step's real entrypoint/command through a shell wrapper so
+		// a failing step keeps its container (and Pod) alive instead of
+		// exiting, giving Attach something to exec into. The wrapper prints
+		// the real exit code behind pauseOnFailureMarker as soon as it's
+		// known, which waitForStepExit watches for, and only then sleeps.
+		command = []string{"/bin/sh", "-c", pauseOnFailureScript}
+		args = append([]string{"woodpecker-step"}, append(append([]string{}, step.Entrypoint...), step.Command...)...)
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      e.podName(step),
+			Namespace: e.namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "woodpecker-exec",
+			},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:    corev1.RestartPolicyNever,
+			ImagePullSecrets: pullSecrets,
+			Containers: []corev1.Container{
+				{
+					Name:    "step",
+					Image:   step.Image,
+					Command: command,
+					Args:    args,
+					Env:     env,
+				},
+			},
+		},
+	}
+}
+
+// pauseOnFailureMarker prefixes the line pauseOnFailureScript prints once
+// the step's real command has exited, letting waitForStepExit learn the
+// exit code from the Pod's logs without waiting for the Pod itself to
+// reach a terminal phase.
+const pauseOnFailureMarker = "##woodpecker-step-exit-code##"
+
+// pauseOnFailureScript runs "$@" (the step's real entrypoint/command,
+// passed as positional args by podForStep) to completion, reports its exit
+// code via pauseOnFailureMarker, and on failure sleeps for an hour instead
+// of exiting, so the Pod stays around long enough for --pause-on-failure
+// to attach an interactive shell to it.
+const pauseOnFailureScript = `"$@"
+code=$?
+echo "` + pauseOnFailureMarker + `$code"
+if [ "$code" -ne 0 ]; then
+	sleep 3600
+fi
+exit "$code"
+`
+
+// waitForStepExit streams the named Pod's logs looking for the line
+// pauseOnFailureScript prints once the step's real command exits, and
+// returns as soon as it sees one, without waiting for the Pod to reach a
+// terminal phase itself (it won't, until the pause sleep elapses). If the
+// log stream ends first, e.g. because the Pod never started at all, it
+// falls back to waitForPod's phase check.
+func (e *Engine) waitForStepExit(ctx context.Context, name string) error {
+	stream, err := e.client.CoreV1().Pods(e.namespace).GetLogs(name, &corev1.PodLogOptions{Follow: true}).Stream(ctx)
+	if err != nil {
+		return fmt.Errorf("stream logs for pod %s: %w", name, err)
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		line := scanner.Text()
+		idx := strings.Index(line, pauseOnFailureMarker)
+		if idx < 0 {
+			continue
+		}
+
+		code, err := strconv.Atoi(strings.TrimSpace(line[idx+len(pauseOnFailureMarker):]))
+		if err != nil {
+			return fmt.Errorf("parse exit code reported by pod %s: %w", name, err)
+		}
+		if code != 0 {
+			return fmt.Errorf("pod %s failed with exit code %d", name, code)
+		}
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read logs for pod %s: %w", name, err)
+	}
+
+	return e.waitForPod(ctx, name)
+}
+
+func (e *Engine) waitForPod(ctx context.Context, name string) error {
+	for {
+		pod, err := e.client.CoreV1().Pods(e.namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("get pod %s: %w", name, err)
+		}
+
+		switch pod.Status.Phase {
+		case corev1.PodSucceeded:
+			return nil
+		case corev1.PodFailed:
+			return fmt.Errorf("pod %s failed", name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// waitForPodRunning blocks until name reaches a phase it can be attached
+// to, used by createDebugPod instead of waitForPod since an idle debug Pod
+// never reaches a terminal phase on its own.
+func (e *Engine) waitForPodRunning(ctx context.Context, name string) error {
+	for {
+		pod, err := e.client.CoreV1().Pods(e.namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("get pod %s: %w", name, err)
+		}
+
+		switch pod.Status.Phase {
+		case corev1.PodRunning, corev1.PodSucceeded:
+			return nil
+		case corev1.PodFailed:
+			return fmt.Errorf("pod %s failed", name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// podName derives a Pod name that is unique across concurrently running
+// pipelines by combining the run id assigned in Setup with the step name.
+func (e *Engine) podName(step *types.Step) string {
+	e.mu.Lock()
+	runID := e.runIDs[step]
+	e.mu.Unlock()
+
+	if runID == "" {
+		runID = "norun"
+	}
+	return fmt.Sprintf("woodpecker-%s-%s", runID, step.Name)
+}
+
+// debugPodName names the short-lived Pod createDebugPod starts for a
+// --step-shell breakpoint that fires before the step's own Pod exists.
+func (e *Engine) debugPodName(step *types.Step) string {
+	return e.podName(step) + "-debug"
+}
+
+// singlePartReader adapts a plain stream into a multipart.Reader that
+// yields exactly one part.
+type singlePartReader struct {
+	r    io.ReadCloser
+	done bool
+}
+
+func newSinglePartReader(r io.ReadCloser) *singlePartReader {
+	return &singlePartReader{r: r}
+}
+
+func (s *singlePartReader) NextPart() (io.Reader, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	s.done = true
+	return s.r, nil
+}
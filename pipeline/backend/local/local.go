@@ -0,0 +1,196 @@
+// Package local implements a pipeline/backend Engine that runs each step
+// as a plain process on the host instead of inside a container, selected
+// with --backend-engine=local or the exec command's --local flag.
+package local
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/woodpecker-ci/woodpecker/pipeline/backend"
+	"github.com/woodpecker-ci/woodpecker/pipeline/backend/types"
+	"github.com/woodpecker-ci/woodpecker/pipeline/multipart"
+)
+
+func init() {
+	backend.Register(New())
+}
+
+// Engine runs pipeline steps as processes on the local host.
+type Engine struct {
+	mu    sync.Mutex
+	procs map[string]*runningStep
+
+	// runSeq and runIDs give every pipeline run (one Setup/Destroy pair) a
+	// unique id, so directories of pipelines with same-named steps don't
+	// collide on procs keys, including under --parallel.
+	runSeq uint64
+	runIDs map[*types.Step]string
+}
+
+// runningStep keeps the plumbing a step's process needs after Exec starts
+// it, so Tail can stream its output and Attach can reach its working
+// directory.
+type runningStep struct {
+	cmd *exec.Cmd
+	dir string
+	log multipart.Reader
+}
+
+// New returns a local Engine.
+func New() *Engine {
+	return &Engine{procs: make(map[string]*runningStep)}
+}
+
+// Name implements types.Engine.
+func (e *Engine) Name() string {
+	return "local"
+}
+
+// Load implements types.Engine. The local engine needs no connection
+// setup.
+func (e *Engine) Load() error {
+	return nil
+}
+
+// Setup implements types.Engine. The local engine has no shared resources
+// to create ahead of running steps, but every step of conf is assigned
+// the same run id here so their procs keys stay unique across
+// concurrently running pipelines.
+func (e *Engine) Setup(_ context.Context, conf *types.Config) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.runSeq++
+	runID := fmt.Sprintf("%d", e.runSeq)
+
+	if e.runIDs == nil {
+		e.runIDs = make(map[*types.Step]string)
+	}
+	for _, step := range conf.Steps {
+		e.runIDs[step] = runID
+	}
+	return nil
+}
+
+// Exec implements types.Engine by running the step's entrypoint/command
+// as a child process, with its combined stdout/stderr captured for Tail.
+func (e *Engine) Exec(ctx context.Context, step *types.Step) error {
+	argv := append(append([]string{}, step.Entrypoint...), step.Command...)
+	if len(argv) == 0 {
+		return fmt.Errorf("step %s has no entrypoint or command to run", step.Name)
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = os.Environ()
+	for k, v := range step.Environment {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	key := e.stepKey(step)
+	e.mu.Lock()
+	e.procs[key] = &runningStep{cmd: cmd, log: newSinglePartReader(pr)}
+	e.mu.Unlock()
+
+	if err := cmd.Start(); err != nil {
+		pw.Close()
+		return fmt.Errorf("start step %s: %w", step.Name, err)
+	}
+
+	err := cmd.Wait()
+	pw.Close()
+	if err != nil {
+		return fmt.Errorf("step %s failed: %w", step.Name, err)
+	}
+	return nil
+}
+
+// Attach implements types.Engine by running cmd as a child process with
+// the step's environment and streaming stdio, the closest local
+// equivalent to exec-ing into a running container.
+func (e *Engine) Attach(ctx context.Context, step *types.Step, cmd []string, stdio types.Stdio) error {
+	if len(cmd) == 0 {
+		return fmt.Errorf("attach requires a command to run")
+	}
+
+	c := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	c.Env = os.Environ()
+	for k, v := range step.Environment {
+		c.Env = append(c.Env, k+"="+v)
+	}
+	c.Stdin = stdio.Stdin
+	c.Stdout = stdio.Stdout
+	c.Stderr = stdio.Stderr
+	return c.Run()
+}
+
+// Tail implements types.Engine by returning the step's captured combined
+// stdout/stderr stream started by Exec.
+func (e *Engine) Tail(_ context.Context, step *types.Step) (multipart.Reader, error) {
+	key := e.stepKey(step)
+	e.mu.Lock()
+	proc, ok := e.procs[key]
+	e.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("step %s has not been started", step.Name)
+	}
+	return proc.log, nil
+}
+
+// Destroy implements types.Engine by forgetting the steps' process state;
+// local processes have already exited by the time Exec returns, so there
+// is nothing left to tear down.
+func (e *Engine) Destroy(_ context.Context, conf *types.Config) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, step := range conf.Steps {
+		delete(e.procs, e.stepKeyLocked(step))
+		delete(e.runIDs, step)
+	}
+	return nil
+}
+
+// stepKey derives a procs key for step that is unique across concurrently
+// running pipelines by combining the run id assigned in Setup with the
+// step name.
+func (e *Engine) stepKey(step *types.Step) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stepKeyLocked(step)
+}
+
+// stepKeyLocked is stepKey for callers that already hold e.mu.
+func (e *Engine) stepKeyLocked(step *types.Step) string {
+	runID := e.runIDs[step]
+	if runID == "" {
+		runID = "norun"
+	}
+	return runID + "-" + step.Name
+}
+
+// singlePartReader adapts a plain stream into a multipart.Reader that
+// yields exactly one part.
+type singlePartReader struct {
+	r    io.Reader
+	done bool
+}
+
+func newSinglePartReader(r io.Reader) *singlePartReader {
+	return &singlePartReader{r: r}
+}
+
+func (s *singlePartReader) NextPart() (io.Reader, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	s.done = true
+	return s.r, nil
+}
@@ -0,0 +1,55 @@
+package backend
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/woodpecker-ci/woodpecker/pipeline/backend/types"
+)
+
+var (
+	enginesMu sync.Mutex
+	engines   = map[string]types.Engine{}
+)
+
+// Register makes a backend engine available by name to FindEngine and the
+// `--backend-engine` flag of `woodpecker exec`. Bundled engines register
+// themselves from an init() function; third-party engines can do the same
+// as long as their package is imported (blank import is enough) before
+// FindEngine is called.
+func Register(engine types.Engine) {
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+	engines[engine.Name()] = engine
+}
+
+// defaultEngineName is the engine FindEngine picks when called with an
+// empty name, matching the exec command's own documented default for
+// --backend-engine.
+const defaultEngineName = "docker"
+
+// FindEngine returns the registered backend engine with the given name. If
+// name is empty, it returns defaultEngineName if registered, or else
+// whichever other engine happens to be registered, so a build importing
+// only a single non-default engine (e.g. kubernetes alone) still works
+// with no --backend-engine flag.
+func FindEngine(name string) (types.Engine, error) {
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+
+	if name == "" {
+		if engine, ok := engines[defaultEngineName]; ok {
+			return engine, nil
+		}
+		for _, engine := range engines {
+			return engine, nil
+		}
+		return nil, fmt.Errorf("no backend engine registered")
+	}
+
+	engine, ok := engines[name]
+	if !ok {
+		return nil, fmt.Errorf("backend engine %q not found, did you forget to import it?", name)
+	}
+	return engine, nil
+}
@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/woodpecker-ci/woodpecker/pipeline/backend/types"
+	"github.com/woodpecker-ci/woodpecker/pipeline/multipart"
+)
+
+// fakeEngine is a minimal types.Engine double for exercising the registry
+// without depending on any of the bundled engine packages.
+type fakeEngine struct {
+	name string
+}
+
+func (f *fakeEngine) Name() string                                   { return f.name }
+func (f *fakeEngine) Load() error                                    { return nil }
+func (f *fakeEngine) Setup(_ context.Context, _ *types.Config) error { return nil }
+func (f *fakeEngine) Exec(_ context.Context, _ *types.Step) error    { return nil }
+func (f *fakeEngine) Attach(_ context.Context, _ *types.Step, _ []string, _ types.Stdio) error {
+	return nil
+}
+func (f *fakeEngine) Tail(_ context.Context, _ *types.Step) (multipart.Reader, error) {
+	return nil, nil
+}
+func (f *fakeEngine) Destroy(_ context.Context, _ *types.Config) error { return nil }
+
+func TestFindEngineReturnsRegisteredEngineByName(t *testing.T) {
+	Register(&fakeEngine{name: "fake-by-name"})
+
+	engine, err := FindEngine("fake-by-name")
+	if err != nil {
+		t.Fatalf("FindEngine: %v", err)
+	}
+	if engine.Name() != "fake-by-name" {
+		t.Fatalf("FindEngine returned engine %q, want fake-by-name", engine.Name())
+	}
+}
+
+func TestFindEngineErrorsOnUnknownName(t *testing.T) {
+	if _, err := FindEngine("does-not-exist"); err == nil {
+		t.Fatal("expected an error for an unregistered engine name")
+	}
+}
+
+func TestFindEngineDefaultsToDocker(t *testing.T) {
+	Register(&fakeEngine{name: defaultEngineName})
+	Register(&fakeEngine{name: "fake-non-default"})
+
+	engine, err := FindEngine("")
+	if err != nil {
+		t.Fatalf("FindEngine: %v", err)
+	}
+	if engine.Name() != defaultEngineName {
+		t.Fatalf("FindEngine(\"\") = %q, want the default engine %q", engine.Name(), defaultEngineName)
+	}
+}
@@ -0,0 +1,46 @@
+package types
+
+import (
+	"context"
+	"io"
+
+	"github.com/woodpecker-ci/woodpecker/pipeline/multipart"
+)
+
+// Stdio wires the interactive streams of an Attach call to a step's
+// container, for debugging breakpoints such as --step-shell.
+type Stdio struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Engine defines a backend capable of running the steps of a compiled
+// pipeline Config. Docker and local are bundled; other engines (e.g.
+// kubernetes) register themselves with backend.Register.
+type Engine interface {
+	// Name returns the unique name of the engine, matched against the
+	// --backend-engine flag.
+	Name() string
+
+	// Load loads and prepares the engine for use, e.g. by connecting to a
+	// daemon or cluster API.
+	Load() error
+
+	// Setup prepares the shared resources (networks, volumes, ...) of a
+	// pipeline Config before any of its steps run.
+	Setup(ctx context.Context, conf *Config) error
+
+	// Exec runs a single step to completion.
+	Exec(ctx context.Context, step *Step) error
+
+	// Attach runs an interactive command inside a step's container, used
+	// by --step-shell and --pause-on-failure to drop into a debug shell.
+	Attach(ctx context.Context, step *Step, cmd []string, stdio Stdio) error
+
+	// Tail streams the log output of a running or finished step.
+	Tail(ctx context.Context, step *Step) (multipart.Reader, error)
+
+	// Destroy tears down the shared resources created by Setup.
+	Destroy(ctx context.Context, conf *Config) error
+}